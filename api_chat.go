@@ -3,6 +3,7 @@ package dify
 import (
 	"context"
 	"net/http"
+	"time"
 )
 
 type ChatMessageRequest struct {
@@ -11,6 +12,18 @@ type ChatMessageRequest struct {
 	ResponseMode   string                 `json:"response_mode"`
 	ConversationID string                 `json:"conversation_id,omitempty"`
 	User           string                 `json:"user"`
+
+	// ReadTimeout bounds how long a single read for the next SSE line may
+	// take before the stream is aborted with ErrStreamReadTimeout. It is
+	// rearmed before every read, independently of IdleTimeout. Only
+	// consulted by the streaming methods; ignored by ChatMessages. Zero
+	// disables it.
+	ReadTimeout time.Duration `json:"-"`
+	// IdleTimeout bounds how long the stream may go without any line
+	// (including heartbeats) before it is aborted with ErrStreamIdle. It is
+	// rearmed only after a line is read, independently of ReadTimeout. Zero
+	// disables it.
+	IdleTimeout time.Duration `json:"-"`
 }
 
 type ChatMessageResponse struct {
@@ -27,14 +40,26 @@ type ChatMessageResponse struct {
 
 /* Create chat message
  * Create a new conversation message or continue an existing dialogue.
+ *
+ * If opts sets an idempotency key (WithIdempotencyKey), a retriable network
+ * error is retried up to maxIdempotentRetries times reusing that same key.
  */
-func (api *API) ChatMessages(ctx context.Context, req *ChatMessageRequest) (resp *ChatMessageResponse, err error) {
+func (api *API) ChatMessages(ctx context.Context, req *ChatMessageRequest, opts ...RequestOption) (resp *ChatMessageResponse, err error) {
 	req.ResponseMode = "blocking"
 
-	httpReq, err := api.createBaseRequest(ctx, http.MethodPost, "/v1/chat-messages", req)
-	if err != nil {
-		return
+	ro := newRequestOptions(opts)
+	attempts := 1
+	if ro.idempotencyKey != "" {
+		attempts = 1 + maxIdempotentRetries
 	}
-	err = api.c.sendJSONRequest(httpReq, &resp)
+
+	err = retryWithBackoff(ctx, attempts, isRetriableNetErr, func() error {
+		httpReq, buildErr := api.createBaseRequest(ctx, http.MethodPost, "/v1/chat-messages", req)
+		if buildErr != nil {
+			return buildErr
+		}
+		ro.apply(httpReq)
+		return api.c.sendJSONRequest(httpReq, &resp)
+	})
 	return
 }
@@ -4,14 +4,27 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
+	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
 )
 
+// ErrStreamIdle is the error reported on the stream channel when neither a
+// data line nor a heartbeat comment arrives within ChatMessageRequest's
+// IdleTimeout.
+var ErrStreamIdle = errors.New("dify: sse stream idle timeout exceeded")
+
+// ErrStreamReadTimeout is the error reported on the stream channel when a
+// single read for the next SSE line takes longer than ChatMessageRequest's
+// ReadTimeout.
+var ErrStreamReadTimeout = errors.New("dify: sse read exceeded ReadTimeout")
+
 type ChatStreamMessageData struct {
 	Event          string `json:"event"`
 	TaskID         string `json:"task_id"`
@@ -150,48 +163,108 @@ type ChatMessageStreamChannelResponse struct {
 	Err   error  `json:"-"`
 }
 
-func (api *API) ChatMessagesStreamRaw(ctx context.Context, req *ChatMessageRequest) (*http.Response, error) {
+func (api *API) ChatMessagesStreamRaw(ctx context.Context, req *ChatMessageRequest, opts ...RequestOption) (*http.Response, error) {
 	req.ResponseMode = "streaming"
 
 	httpReq, err := api.createBaseRequest(ctx, http.MethodPost, "/v1/chat-messages", req)
 	if err != nil {
 		return nil, err
 	}
+	newRequestOptions(opts).apply(httpReq)
 	return api.c.sendRequest(httpReq)
 }
 
-func (api *API) ChatMessagesStream(ctx context.Context, req *ChatMessageRequest) (chan ChatMessageStreamChannelResponse, error) {
-	httpResp, err := api.ChatMessagesStreamRaw(ctx, req)
+func (api *API) ChatMessagesStream(ctx context.Context, req *ChatMessageRequest, opts ...RequestOption) (chan ChatMessageStreamChannelResponse, error) {
+	httpResp, err := api.ChatMessagesStreamRaw(ctx, req, opts...)
 	if err != nil {
 		return nil, err
 	}
 
 	streamChannel := make(chan ChatMessageStreamChannelResponse)
-	go api.chatMessagesStreamHandle(ctx, httpResp, streamChannel)
+	go api.chatMessagesStreamHandle(ctx, httpResp, req, streamChannel)
 	return streamChannel, nil
 }
 
-func (api *API) chatMessagesStreamHandle(ctx context.Context, resp *http.Response, streamChannel chan ChatMessageStreamChannelResponse) {
+func (api *API) chatMessagesStreamHandle(ctx context.Context, resp *http.Response, req *ChatMessageRequest, streamChannel chan ChatMessageStreamChannelResponse) {
 	defer resp.Body.Close()
 	defer close(streamChannel)
 
 	reader := bufio.NewReader(resp.Body)
+
+	// ReadTimeout and IdleTimeout are independent deadlines, so they get
+	// independent timers: readTimer is rearmed before every ReadBytes call
+	// and bounds that one call, while idleTimer is rearmed only after a
+	// line is actually read and bounds the stream's total silence. Both
+	// close resp.Body to unblock a stuck read; a sync.Once on each guards
+	// against the close-of-closed-channel panic from a Reset racing its
+	// own callback.
+	var readTimer, idleTimer *time.Timer
+	readExpired := make(chan struct{})
+	idleExpired := make(chan struct{})
+	var closeReadOnce, closeIdleOnce sync.Once
+	closeRead := func() { closeReadOnce.Do(func() { close(readExpired) }) }
+	closeIdle := func() { closeIdleOnce.Do(func() { close(idleExpired) }) }
+	if req.ReadTimeout > 0 {
+		readTimer = time.AfterFunc(req.ReadTimeout, func() {
+			closeRead()
+			resp.Body.Close()
+		})
+		defer readTimer.Stop()
+	}
+	if req.IdleTimeout > 0 {
+		idleTimer = time.AfterFunc(req.IdleTimeout, func() {
+			closeIdle()
+			resp.Body.Close()
+		})
+		defer idleTimer.Stop()
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-readExpired:
+			streamChannel <- ChatMessageStreamChannelResponse{Event: "error", Err: ErrStreamReadTimeout}
+			return
+		case <-idleExpired:
+			streamChannel <- ChatMessageStreamChannelResponse{Event: "error", Err: ErrStreamIdle}
+			return
 		default:
+			if readTimer != nil {
+				readTimer.Reset(req.ReadTimeout)
+			}
+
 			line, err := reader.ReadBytes('\n')
+			if readTimer != nil {
+				readTimer.Stop()
+			}
 			if err != nil {
 				if err == io.EOF {
 					return
 				}
-				streamChannel <- ChatMessageStreamChannelResponse{
-					Err: fmt.Errorf("error reading line: %w", err),
+				select {
+				case <-readExpired:
+					streamChannel <- ChatMessageStreamChannelResponse{Event: "error", Err: ErrStreamReadTimeout}
+				case <-idleExpired:
+					streamChannel <- ChatMessageStreamChannelResponse{Event: "error", Err: ErrStreamIdle}
+				default:
+					streamChannel <- ChatMessageStreamChannelResponse{
+						Err: fmt.Errorf("error reading line: %w", err),
+					}
 				}
 				return
 			}
 
+			if idleTimer != nil {
+				idleTimer.Reset(req.IdleTimeout)
+			}
+
+			if bytes.HasPrefix(line, []byte(":")) {
+				comment := bytes.TrimSpace(bytes.TrimPrefix(line, []byte(":")))
+				streamChannel <- ChatMessageStreamChannelResponse{Event: "heartbeat", Data: string(comment)}
+				continue
+			}
+
 			if !bytes.HasPrefix(line, []byte("data:")) {
 				continue
 			}
@@ -207,87 +280,13 @@ func (api *API) chatMessagesStreamHandle(ctx context.Context, resp *http.Respons
 				Event: event,
 			}
 
-			switch event {
-			case "message":
-				var data ChatStreamMessageData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-
-			case "message_file":
-				var data ChatStreamMessageFileData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-			case "message_end":
-				var data ChatStreamMessageEndData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-			case "tts_message":
-				var data ChatStreamTTSMessageData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-			case "tts_message_end":
-				var data ChatStreamTTSMessageEndData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-			case "workflow_started":
-				var data ChatStreamWorkflowStartedData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-			case "workflow_finished":
-				var data ChatStreamWorkflowFinishedData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-			case "node_started":
-				var data ChatStreamNodeStartedData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-			case "node_finished":
-				var data ChatStreamNodeFinishedData
-				if err = json.Unmarshal(line, &data); err != nil {
-					resp.Err = err
-					resp.Event = "error"
-				} else {
-					resp.Data = &data
-				}
-			case "error":
-				var data ChatStreamErrorData
-				if err = json.Unmarshal(line, &data); err != nil {
+			if typ, ok := eventTypeRegistry[event]; ok {
+				data := reflect.New(typ)
+				if err = json.Unmarshal(line, data.Interface()); err != nil {
 					resp.Err = err
 					resp.Event = "error"
 				} else {
-					resp.Data = &data
+					resp.Data = data.Interface()
 				}
 			}
 
@@ -0,0 +1,232 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// eventTypeRegistry maps a Dify SSE event name to the concrete struct type
+// its "data" payload decodes into. chatMessagesStreamHandle uses it to pick
+// an unmarshal target, and EventBus uses it to validate handlers registered
+// via On.
+var eventTypeRegistry = map[string]reflect.Type{
+	"message":           reflect.TypeOf(ChatStreamMessageData{}),
+	"message_file":      reflect.TypeOf(ChatStreamMessageFileData{}),
+	"message_end":       reflect.TypeOf(ChatStreamMessageEndData{}),
+	"message_replace":   reflect.TypeOf(ChatStreamMessageReplaceData{}),
+	"tts_message":       reflect.TypeOf(ChatStreamTTSMessageData{}),
+	"tts_message_end":   reflect.TypeOf(ChatStreamTTSMessageEndData{}),
+	"workflow_started":  reflect.TypeOf(ChatStreamWorkflowStartedData{}),
+	"workflow_finished": reflect.TypeOf(ChatStreamWorkflowFinishedData{}),
+	"node_started":      reflect.TypeOf(ChatStreamNodeStartedData{}),
+	"node_finished":     reflect.TypeOf(ChatStreamNodeFinishedData{}),
+	"error":             reflect.TypeOf(ChatStreamErrorData{}),
+}
+
+// ErrUnknownEvent is returned when On is called with an event name that has
+// no entry in eventTypeRegistry.
+var ErrUnknownEvent = errors.New("dify: no registered struct type for event")
+
+// ErrHandlerSignature is returned when a handler passed to On does not
+// accept a pointer to the event's registered struct type.
+var ErrHandlerSignature = errors.New("dify: handler must accept a pointer to the event's registered struct type")
+
+// Subscription is returned by every On* registration on EventBus. Call Off
+// to stop receiving events on it; Off is safe to call more than once.
+type Subscription struct {
+	bus   *EventBus
+	event string
+	id    uint64
+}
+
+// Off removes the handler this Subscription was returned for.
+func (s *Subscription) Off() {
+	s.bus.off(s.event, s.id)
+}
+
+type busHandler struct {
+	id uint64
+	fn reflect.Value
+}
+
+// EventBus is a typed pub/sub layer over a chat message stream. It is
+// obtained from ChatMessagesStreamBus and lets callers register per-event
+// handlers instead of driving the ChatMessageStreamChannelResponse channel
+// and type-switching on Data themselves.
+type EventBus struct {
+	ch chan ChatMessageStreamChannelResponse
+
+	mu       sync.Mutex
+	nextID   uint64
+	handlers map[string][]busHandler
+	workers  int
+
+	done chan struct{}
+	err  error
+}
+
+// ChatMessagesStreamBus starts a chat message stream and returns an EventBus
+// for it. Register handlers with On/OnMessage/... before or after the
+// stream starts delivering events; Wait blocks until it ends.
+func (api *API) ChatMessagesStreamBus(ctx context.Context, req *ChatMessageRequest, opts ...RequestOption) (*EventBus, error) {
+	ch, err := api.ChatMessagesStream(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	bus := &EventBus{
+		ch:       ch,
+		handlers: make(map[string][]busHandler),
+		done:     make(chan struct{}),
+	}
+	go bus.dispatch()
+	return bus, nil
+}
+
+// SetWorkers bounds how many handlers for a single event run concurrently.
+// The zero value (the default) invokes handlers serially on the dispatcher
+// goroutine, preserving event order.
+func (bus *EventBus) SetWorkers(n int) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.workers = n
+}
+
+func (bus *EventBus) dispatch() {
+	defer close(bus.done)
+	for resp := range bus.ch {
+		if resp.Err != nil {
+			bus.mu.Lock()
+			bus.err = resp.Err
+			bus.mu.Unlock()
+		}
+		bus.emit(resp.Event, resp.Data)
+	}
+}
+
+func (bus *EventBus) emit(event string, data any) {
+	if data == nil {
+		return
+	}
+
+	bus.mu.Lock()
+	handlers := append([]busHandler(nil), bus.handlers[event]...)
+	workers := bus.workers
+	bus.mu.Unlock()
+
+	arg := reflect.ValueOf(data)
+	call := func(h busHandler) { h.fn.Call([]reflect.Value{arg}) }
+
+	if workers <= 0 {
+		for _, h := range handlers {
+			call(h)
+		}
+		return
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, h := range handlers {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(h busHandler) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			call(h)
+		}(h)
+	}
+	wg.Wait()
+}
+
+// On registers fn for event, validating that fn is a func accepting a
+// pointer to the struct type eventTypeRegistry associates with event.
+func (bus *EventBus) On(event string, fn any) (*Subscription, error) {
+	typ, ok := eventTypeRegistry[event]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEvent, event)
+	}
+
+	fv := reflect.ValueOf(fn)
+	want := reflect.PointerTo(typ)
+	if fv.Kind() != reflect.Func || fv.Type().NumIn() != 1 || fv.Type().In(0) != want {
+		return nil, fmt.Errorf("%w: event %q wants func(%s)", ErrHandlerSignature, event, want)
+	}
+
+	return bus.register(event, fv), nil
+}
+
+func (bus *EventBus) register(event string, fv reflect.Value) *Subscription {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	bus.nextID++
+	id := bus.nextID
+	bus.handlers[event] = append(bus.handlers[event], busHandler{id: id, fn: fv})
+	return &Subscription{bus: bus, event: event, id: id}
+}
+
+func (bus *EventBus) off(event string, id uint64) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	handlers := bus.handlers[event]
+	for i, h := range handlers {
+		if h.id == id {
+			bus.handlers[event] = append(handlers[:i], handlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// OnMessage registers fn to run for every "message" event.
+func (bus *EventBus) OnMessage(fn func(*ChatStreamMessageData)) *Subscription {
+	sub, _ := bus.On("message", fn)
+	return sub
+}
+
+// OnMessageEnd registers fn to run for every "message_end" event.
+func (bus *EventBus) OnMessageEnd(fn func(*ChatStreamMessageEndData)) *Subscription {
+	sub, _ := bus.On("message_end", fn)
+	return sub
+}
+
+// OnWorkflowStarted registers fn to run for every "workflow_started" event.
+func (bus *EventBus) OnWorkflowStarted(fn func(*ChatStreamWorkflowStartedData)) *Subscription {
+	sub, _ := bus.On("workflow_started", fn)
+	return sub
+}
+
+// OnNodeFinished registers fn to run for every "node_finished" event.
+func (bus *EventBus) OnNodeFinished(fn func(*ChatStreamNodeFinishedData)) *Subscription {
+	sub, _ := bus.On("node_finished", fn)
+	return sub
+}
+
+// OnTTS registers fn to run for every "tts_message" event.
+func (bus *EventBus) OnTTS(fn func(*ChatStreamTTSMessageData)) *Subscription {
+	sub, _ := bus.On("tts_message", fn)
+	return sub
+}
+
+// OnError registers fn to run for every "error" event.
+func (bus *EventBus) OnError(fn func(*ChatStreamErrorData)) *Subscription {
+	sub, _ := bus.On("error", fn)
+	return sub
+}
+
+// Wait blocks until the underlying stream ends, whether cleanly or due to
+// an error. Check Err afterwards to distinguish the two.
+func (bus *EventBus) Wait() {
+	<-bus.done
+}
+
+// Err returns the terminal error of the stream, if any. It is only
+// meaningful after Wait returns.
+func (bus *EventBus) Err() error {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	return bus.err
+}
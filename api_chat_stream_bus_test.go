@@ -0,0 +1,76 @@
+package dify
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventBusOn(t *testing.T) {
+	t.Run("valid handler", func(t *testing.T) {
+		bus := &EventBus{handlers: make(map[string][]busHandler)}
+		sub, err := bus.On("message_end", func(*ChatStreamMessageEndData) {})
+		if err != nil {
+			t.Fatalf("On() error = %v, want nil", err)
+		}
+		if sub == nil {
+			t.Fatal("On() returned nil Subscription")
+		}
+	})
+
+	t.Run("unknown event", func(t *testing.T) {
+		bus := &EventBus{handlers: make(map[string][]busHandler)}
+		_, err := bus.On("not_a_real_event", func(*ChatStreamMessageEndData) {})
+		if !errors.Is(err, ErrUnknownEvent) {
+			t.Fatalf("On() error = %v, want ErrUnknownEvent", err)
+		}
+	})
+
+	t.Run("mismatched payload type", func(t *testing.T) {
+		bus := &EventBus{handlers: make(map[string][]busHandler)}
+		_, err := bus.On("message_end", func(*ChatStreamErrorData) {})
+		if !errors.Is(err, ErrHandlerSignature) {
+			t.Fatalf("On() error = %v, want ErrHandlerSignature", err)
+		}
+	})
+
+	t.Run("non-func handler", func(t *testing.T) {
+		bus := &EventBus{handlers: make(map[string][]busHandler)}
+		_, err := bus.On("message_end", "not a function")
+		if !errors.Is(err, ErrHandlerSignature) {
+			t.Fatalf("On() error = %v, want ErrHandlerSignature", err)
+		}
+	})
+}
+
+func TestEventBusEmitInvokesHandler(t *testing.T) {
+	bus := &EventBus{handlers: make(map[string][]busHandler)}
+
+	var got *ChatStreamMessageEndData
+	if _, err := bus.On("message_end", func(d *ChatStreamMessageEndData) { got = d }); err != nil {
+		t.Fatalf("On() error = %v", err)
+	}
+
+	want := &ChatStreamMessageEndData{MessageID: "msg-1"}
+	bus.emit("message_end", want)
+
+	if got != want {
+		t.Errorf("handler received %v, want %v", got, want)
+	}
+}
+
+func TestEventBusOff(t *testing.T) {
+	bus := &EventBus{handlers: make(map[string][]busHandler)}
+
+	calls := 0
+	sub, err := bus.On("message_end", func(*ChatStreamMessageEndData) { calls++ })
+	if err != nil {
+		t.Fatalf("On() error = %v", err)
+	}
+
+	sub.Off()
+	bus.emit("message_end", &ChatStreamMessageEndData{})
+
+	if calls != 0 {
+		t.Errorf("handler called %d times after Off, want 0", calls)
+	}
+}
@@ -0,0 +1,342 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ConnState describes the lifecycle of a ChatMessagesStreamResilient
+// connection, mirroring the connected/disconnected/reconnected states of a
+// long-lived pub/sub client. It is carried on ReconnectEventData so callers
+// can switch on it instead of the event name alone.
+type ConnState int
+
+const (
+	ConnStateConnected ConnState = iota
+	ConnStateDisconnected
+	ConnStateReconnected
+)
+
+// ReconnectOptions configures the backoff used by
+// ChatMessagesStreamResilient between reconnect attempts.
+type ReconnectOptions struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	// MaxAttempts bounds consecutive reconnect attempts; zero means retry
+	// indefinitely.
+	MaxAttempts int
+	// Jitter is the fraction (0..1) of each computed delay to randomize.
+	Jitter float64
+}
+
+// DefaultReconnectOptions returns sensible defaults for
+// ChatMessagesStreamResilient.
+func DefaultReconnectOptions() ReconnectOptions {
+	return ReconnectOptions{
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     30 * time.Second,
+		MaxAttempts:  0,
+		Jitter:       0.2,
+	}
+}
+
+// ReconnectEventData is carried as the Data of "reconnect" and "reconnected"
+// events. State is ConnStateDisconnected on "reconnect" (about to redial or
+// re-poll after a disconnect) and ConnStateReconnected on "reconnected".
+type ReconnectEventData struct {
+	Attempt int
+	Err     error
+	State   ConnState
+}
+
+// StreamStatusError wraps a non-2xx response observed when (re)dialing a
+// chat stream, so isRetriableStreamErr can tell a permanent Dify rejection
+// (bad request, bad API key) from a transient failure worth retrying.
+type StreamStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StreamStatusError) Error() string {
+	return fmt.Sprintf("dify: chat stream dial returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// ChatMessagesStreamResilient behaves like ChatMessagesStream, but
+// transparently retries on transport errors or stream idle timeouts using
+// opts for backoff, emitting a "reconnect" event before each retry so
+// callers can render a "reconnecting..." indicator. Errors Dify reports as
+// non-retriable (4xx other than 429, a canceled context) terminate the
+// channel without retrying.
+//
+// Dify has no way to resume a live SSE stream mid-generation, so once the
+// first dial has triggered a generation, a disconnect is never recovered by
+// redialing /v1/chat-messages (that would fork a second, duplicate answer).
+// Instead, resume is purely backfill-based: the conversation history is
+// polled for whatever the server has persisted since the disconnect, and
+// the stream ends once that's delivered. Consequently the "reconnected"
+// event only fires for the initial-dial case (the very first call to Dify
+// failed and a retry got through before any generation started); it is
+// never emitted for a drop mid-generation, since that path resolves via
+// backfill and ends the stream instead of resuming it live.
+func (api *API) ChatMessagesStreamResilient(ctx context.Context, req *ChatMessageRequest, opts ReconnectOptions, reqOpts ...RequestOption) (chan ChatMessageStreamChannelResponse, error) {
+	out := make(chan ChatMessageStreamChannelResponse)
+	go api.resilientStreamLoop(ctx, req, opts, reqOpts, out)
+	return out, nil
+}
+
+func (api *API) resilientStreamLoop(ctx context.Context, req *ChatMessageRequest, opts ReconnectOptions, reqOpts []RequestOption, out chan ChatMessageStreamChannelResponse) {
+	defer close(out)
+
+	var lastConversationID, lastMessageID string
+	attempt := 0
+	generationStarted := false
+
+	for {
+		if generationStarted {
+			if lastConversationID != "" {
+				api.backfillResilient(ctx, req, opts, lastConversationID, lastMessageID, out)
+			}
+			return
+		}
+
+		inner, err := api.dialChatStream(ctx, req, reqOpts)
+		if err == nil {
+			generationStarted = true
+			reconnected := attempt > 0
+			var streamErr error
+
+			for resp := range inner {
+				if cid, mid, ok := extractStreamIDs(resp); ok {
+					if cid != "" {
+						lastConversationID = cid
+					}
+					if mid != "" {
+						lastMessageID = mid
+					}
+				}
+				if resp.Err != nil {
+					// Don't forward a terminal error event we're about to
+					// retry; the caller would see a spurious "error"
+					// immediately followed by "reconnect".
+					streamErr = resp.Err
+					continue
+				}
+				if reconnected {
+					out <- ChatMessageStreamChannelResponse{
+						Event: "reconnected",
+						Data:  ReconnectEventData{Attempt: attempt, State: ConnStateReconnected},
+					}
+					reconnected = false
+				}
+				out <- resp
+			}
+
+			if streamErr == nil {
+				return
+			}
+			err = streamErr
+		}
+
+		if !isRetriableStreamErr(ctx, err) {
+			out <- ChatMessageStreamChannelResponse{Event: "error", Err: err}
+			return
+		}
+
+		attempt++
+		if opts.MaxAttempts > 0 && attempt > opts.MaxAttempts {
+			out <- ChatMessageStreamChannelResponse{
+				Event: "error",
+				Err:   fmt.Errorf("dify: giving up after %d reconnect attempts: %w", attempt-1, err),
+			}
+			return
+		}
+
+		out <- ChatMessageStreamChannelResponse{
+			Event: "reconnect",
+			Data:  ReconnectEventData{Attempt: attempt, Err: err, State: ConnStateDisconnected},
+		}
+
+		if !sleepBackoff(ctx, opts, attempt) {
+			return
+		}
+	}
+}
+
+// dialChatStream opens a chat stream like ChatMessagesStream, but first
+// inspects the response status so a 4xx rejection from Dify surfaces as a
+// *StreamStatusError instead of being silently fed to the SSE parser.
+func (api *API) dialChatStream(ctx context.Context, req *ChatMessageRequest, reqOpts []RequestOption) (chan ChatMessageStreamChannelResponse, error) {
+	httpResp, err := api.ChatMessagesStreamRaw(ctx, req, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if httpResp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(httpResp.Body, 4096))
+		httpResp.Body.Close()
+		return nil, &StreamStatusError{StatusCode: httpResp.StatusCode, Body: string(body)}
+	}
+
+	streamChannel := make(chan ChatMessageStreamChannelResponse)
+	go api.chatMessagesStreamHandle(ctx, httpResp, req, streamChannel)
+	return streamChannel, nil
+}
+
+// extractStreamIDs pulls the conversation/message IDs out of the handful of
+// event payloads that carry them, so the reconnect loop can track what has
+// already been delivered.
+func extractStreamIDs(resp ChatMessageStreamChannelResponse) (conversationID, messageID string, ok bool) {
+	switch d := resp.Data.(type) {
+	case *ChatStreamMessageData:
+		return d.ConversationID, d.MessageID, true
+	case *ChatStreamMessageEndData:
+		return d.ConversationID, d.MessageID, true
+	case *ChatStreamMessageReplaceData:
+		return d.ConversationID, d.MessageID, true
+	case *ChatStreamMessageFileData:
+		return d.ConversationID, "", true
+	}
+	return "", "", false
+}
+
+// isRetriableStreamErr reports whether a (re)dial or in-stream error is
+// worth retrying. A canceled/expired context, and any 4xx Dify response
+// other than 429, are treated as permanent.
+func isRetriableStreamErr(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *StreamStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode == http.StatusTooManyRequests {
+			return true
+		}
+		if statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sleepBackoff(ctx context.Context, opts ReconnectOptions, attempt int) bool {
+	delay := opts.InitialDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay > opts.MaxDelay {
+			delay = opts.MaxDelay
+			break
+		}
+	}
+	if opts.Jitter > 0 {
+		delta := time.Duration(float64(delay) * opts.Jitter * (rand.Float64()*2 - 1))
+		delay += delta
+		if delay < 0 {
+			delay = 0
+		}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// messagesListResponse is the subset of GET /v1/messages this package reads
+// when backfilling chunks emitted while a stream was disconnected.
+type messagesListResponse struct {
+	Data []struct {
+		ID             string `json:"id"`
+		ConversationID string `json:"conversation_id"`
+		Answer         string `json:"answer"`
+	} `json:"data"`
+	HasMore bool `json:"has_more"`
+}
+
+// backfillResilient retries backfillMessages with the same backoff used for
+// reconnects, since this is the only recovery path left once a generation
+// has already started server-side.
+func (api *API) backfillResilient(ctx context.Context, req *ChatMessageRequest, opts ReconnectOptions, conversationID, messageID string, out chan ChatMessageStreamChannelResponse) {
+	attempt := 0
+	for {
+		err := api.backfillMessages(ctx, req, conversationID, messageID, out)
+		if err == nil || !isRetriableNetErr(err) {
+			return
+		}
+
+		attempt++
+		if opts.MaxAttempts > 0 && attempt > opts.MaxAttempts {
+			return
+		}
+
+		out <- ChatMessageStreamChannelResponse{
+			Event: "reconnect",
+			Data:  ReconnectEventData{Attempt: attempt, Err: err, State: ConnStateDisconnected},
+		}
+
+		if !sleepBackoff(ctx, opts, attempt) {
+			return
+		}
+	}
+}
+
+// backfillMessages looks for messageID - the message that was in flight
+// when the stream dropped - in the conversation's most recent history and,
+// if Dify has since persisted its final answer, replays it.
+//
+// GET /v1/messages paginates backward from first_id (it returns records
+// older than first_id, for scrolling back into history); there is no
+// first_id value that pages forward from the disconnect point. So this
+// fetches the latest page (no first_id) and matches messageID within it,
+// rather than trying to "continue" pagination from where the stream left
+// off.
+func (api *API) backfillMessages(ctx context.Context, req *ChatMessageRequest, conversationID, messageID string, out chan ChatMessageStreamChannelResponse) error {
+	path := fmt.Sprintf("/v1/messages?%s", url.Values{
+		"conversation_id": {conversationID},
+		"user":            {req.User},
+	}.Encode())
+
+	httpReq, err := api.createBaseRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	var resp messagesListResponse
+	if err := api.c.sendJSONRequest(httpReq, &resp); err != nil {
+		return err
+	}
+
+	for _, m := range resp.Data {
+		if m.ID != messageID {
+			continue
+		}
+		out <- ChatMessageStreamChannelResponse{
+			Event: "message",
+			Data: &ChatStreamMessageData{
+				Event:          "message",
+				MessageID:      m.ID,
+				ConversationID: m.ConversationID,
+				Answer:         m.Answer,
+			},
+		}
+		return nil
+	}
+	return nil
+}
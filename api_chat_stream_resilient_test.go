@@ -0,0 +1,39 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestIsRetriableStreamErr(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"nil error", context.Background(), nil, false},
+		{"context already canceled", canceledCtx, errors.New("read tcp: use of closed network connection"), false},
+		{"context.Canceled error", context.Background(), context.Canceled, false},
+		{"context.DeadlineExceeded error", context.Background(), context.DeadlineExceeded, false},
+		{"generic transport error", context.Background(), errors.New("connection reset by peer"), true},
+		{"400 is non-retriable", context.Background(), &StreamStatusError{StatusCode: http.StatusBadRequest}, false},
+		{"401 is non-retriable", context.Background(), &StreamStatusError{StatusCode: http.StatusUnauthorized}, false},
+		{"429 is retriable", context.Background(), &StreamStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"500 is retriable", context.Background(), &StreamStatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"503 is retriable", context.Background(), &StreamStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetriableStreamErr(tc.ctx, tc.err); got != tc.want {
+				t.Errorf("isRetriableStreamErr(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
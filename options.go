@@ -0,0 +1,113 @@
+package dify
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RequestOption customizes a single outgoing API call, e.g.
+// WithIdempotencyKey or WithRequestHeader.
+type RequestOption func(*requestOptions)
+
+type requestOptions struct {
+	headers           http.Header
+	idempotencyKey    string
+	idempotencyExpiry time.Duration
+}
+
+func newRequestOptions(opts []RequestOption) *requestOptions {
+	ro := &requestOptions{headers: make(http.Header)}
+	for _, opt := range opts {
+		opt(ro)
+	}
+	return ro
+}
+
+// apply sets the headers opts collected onto httpReq.
+func (ro *requestOptions) apply(httpReq *http.Request) {
+	for k, vs := range ro.headers {
+		for _, v := range vs {
+			httpReq.Header.Add(k, v)
+		}
+	}
+	if ro.idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", ro.idempotencyKey)
+		if ro.idempotencyExpiry > 0 {
+			httpReq.Header.Set("Idempotency-Expiry", ro.idempotencyExpiry.String())
+		}
+	}
+}
+
+// WithIdempotencyKey sets the Idempotency-Key header, letting a retried call
+// reuse the same key so Dify can dedupe it server-side.
+func WithIdempotencyKey(key string) RequestOption {
+	return func(ro *requestOptions) { ro.idempotencyKey = key }
+}
+
+// WithIdempotencyExpiry sets the Idempotency-Expiry header alongside an
+// idempotency key, bounding how long Dify remembers it.
+func WithIdempotencyExpiry(d time.Duration) RequestOption {
+	return func(ro *requestOptions) { ro.idempotencyExpiry = d }
+}
+
+// WithRequestHeader attaches an arbitrary header to a single call.
+func WithRequestHeader(k, v string) RequestOption {
+	return func(ro *requestOptions) { ro.headers.Add(k, v) }
+}
+
+// NewIdempotencyKey returns a random UUIDv4 suitable for WithIdempotencyKey.
+func NewIdempotencyKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// maxIdempotentRetries bounds how many times an idempotency-keyed call is
+// retried after a retriable network error.
+const maxIdempotentRetries = 3
+
+// retryWithBackoff calls fn until it succeeds, retriable returns false for
+// its error, or attempts is exhausted, waiting with exponential backoff
+// between tries.
+func retryWithBackoff(ctx context.Context, attempts int, retriable func(error) bool, fn func() error) error {
+	delay := 200 * time.Millisecond
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil || !retriable(err) {
+			return err
+		}
+		if i == attempts-1 {
+			break
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// isRetriableNetErr reports whether err looks like a transient network
+// failure worth retrying an idempotency-keyed request for.
+func isRetriableNetErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
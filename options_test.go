@@ -0,0 +1,96 @@
+package dify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestIsRetriableNetErr(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"net.Error", &net.DNSError{IsTimeout: true}, true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"EOF", io.EOF, true},
+		{"generic error", errors.New("boom"), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetriableNetErr(tc.err); got != tc.want {
+				t.Errorf("isRetriableNetErr(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	t.Run("succeeds after retriable errors", func(t *testing.T) {
+		attempts := 0
+		err := retryWithBackoff(context.Background(), 3, func(error) bool { return true }, func() error {
+			attempts++
+			if attempts < 3 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("retryWithBackoff() = %v, want nil", err)
+		}
+		if attempts != 3 {
+			t.Errorf("attempts = %d, want 3", attempts)
+		}
+	})
+
+	t.Run("stops on non-retriable error", func(t *testing.T) {
+		attempts := 0
+		wantErr := errors.New("permanent")
+		err := retryWithBackoff(context.Background(), 3, func(error) bool { return false }, func() error {
+			attempts++
+			return wantErr
+		})
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("retryWithBackoff() = %v, want %v", err, wantErr)
+		}
+		if attempts != 1 {
+			t.Errorf("attempts = %d, want 1", attempts)
+		}
+	})
+
+	t.Run("gives up after exhausting attempts", func(t *testing.T) {
+		attempts := 0
+		err := retryWithBackoff(context.Background(), 2, func(error) bool { return true }, func() error {
+			attempts++
+			return io.EOF
+		})
+		if !errors.Is(err, io.EOF) {
+			t.Fatalf("retryWithBackoff() = %v, want io.EOF", err)
+		}
+		if attempts != 2 {
+			t.Errorf("attempts = %d, want 2", attempts)
+		}
+	})
+
+	t.Run("aborts on context cancel between retries", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		attempts := 0
+		err := retryWithBackoff(ctx, 3, func(error) bool { return true }, func() error {
+			attempts++
+			return io.EOF
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("retryWithBackoff() = %v, want context.Canceled", err)
+		}
+		if attempts != 1 {
+			t.Errorf("attempts = %d, want 1", attempts)
+		}
+	})
+}
+
@@ -0,0 +1,205 @@
+package dify
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	webhookSignatureHeader = "X-Dify-Signature"
+	webhookTimestampHeader = "X-Dify-Timestamp"
+	webhookEventIDHeader   = "X-Dify-Event-Id"
+
+	defaultReplayWindow  = 5 * time.Minute
+	seenWebhookEventsMax = 4096
+	maxWebhookBodyBytes  = 1 << 20
+)
+
+var (
+	ErrBadSignature         = errors.New("dify: webhook signature mismatch")
+	ErrReplayedEvent        = errors.New("dify: webhook event already processed")
+	ErrStaleEvent           = errors.New("dify: webhook timestamp outside replay window")
+	ErrMissingReplayHeaders = errors.New("dify: webhook missing timestamp or event-id header")
+)
+
+// EventHandler receives typed callbacks for the Dify webhook events
+// WebhookServer knows how to decode. Embed NoopEventHandler to implement
+// only the events a given service cares about.
+type EventHandler interface {
+	OnMessageEnd(*ChatStreamMessageEndData)
+	OnWorkflowFinished(*ChatStreamWorkflowFinishedData)
+	OnNodeFinished(*ChatStreamNodeFinishedData)
+	OnError(*ChatStreamErrorData)
+}
+
+// NoopEventHandler implements EventHandler with no-op methods.
+type NoopEventHandler struct{}
+
+func (NoopEventHandler) OnMessageEnd(*ChatStreamMessageEndData)             {}
+func (NoopEventHandler) OnWorkflowFinished(*ChatStreamWorkflowFinishedData) {}
+func (NoopEventHandler) OnNodeFinished(*ChatStreamNodeFinishedData)         {}
+func (NoopEventHandler) OnError(*ChatStreamErrorData)                      {}
+
+// WebhookServer verifies and dispatches inbound Dify webhook deliveries. It
+// implements http.Handler directly and can also be mounted under a
+// caller-chosen path via Mux.
+type WebhookServer struct {
+	secret       []byte
+	handler      EventHandler
+	replayWindow time.Duration
+
+	mu   sync.Mutex
+	seen *list.List
+	idx  map[string]*list.Element
+}
+
+// NewWebhookServer returns a WebhookServer that verifies deliveries against
+// secret and dispatches decoded events to handler.
+func NewWebhookServer(secret string, handler EventHandler) *WebhookServer {
+	return &WebhookServer{
+		secret:       []byte(secret),
+		handler:      handler,
+		replayWindow: defaultReplayWindow,
+		seen:         list.New(),
+		idx:          make(map[string]*list.Element),
+	}
+}
+
+// Mux registers the webhook receiver on mux at path.
+func (w *WebhookServer) Mux(mux *http.ServeMux, path string) {
+	mux.Handle(path, w)
+}
+
+func (w *WebhookServer) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "dify: method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+	if err != nil {
+		http.Error(rw, "dify: cannot read body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := w.verify(r, body); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrReplayedEvent) {
+			status = http.StatusConflict
+		}
+		http.Error(rw, err.Error(), status)
+		return
+	}
+
+	if err := w.dispatch(body); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+func (w *WebhookServer) verify(r *http.Request, body []byte) error {
+	ts := r.Header.Get(webhookTimestampHeader)
+	id := r.Header.Get(webhookEventIDHeader)
+	if ts == "" || id == "" {
+		// Without both headers there is nothing to bind the signature to a
+		// point in time, or to dedupe on, so replay protection is a no-op;
+		// reject outright rather than accept a delivery we can't protect.
+		return ErrMissingReplayHeaders
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("dify: invalid %s header: %w", webhookTimestampHeader, err)
+	}
+	if age := time.Since(time.Unix(sec, 0)); age < 0 || age > w.replayWindow {
+		return ErrStaleEvent
+	}
+
+	// Sign "timestamp.body" (Stripe-style) so the timestamp can't be
+	// rewritten on a captured delivery without invalidating the signature.
+	mac := hmac.New(sha256.New, w.secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	got := r.Header.Get(webhookSignatureHeader)
+	if got == "" || !hmac.Equal([]byte(expected), []byte(got)) {
+		return ErrBadSignature
+	}
+
+	if !w.rememberEvent(id) {
+		return ErrReplayedEvent
+	}
+
+	return nil
+}
+
+// rememberEvent reports whether id has not been seen before, recording it
+// in a bounded LRU of recent event IDs for replay protection.
+func (w *WebhookServer) rememberEvent(id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.idx[id]; ok {
+		return false
+	}
+
+	w.idx[id] = w.seen.PushBack(id)
+	for w.seen.Len() > seenWebhookEventsMax {
+		oldest := w.seen.Front()
+		w.seen.Remove(oldest)
+		delete(w.idx, oldest.Value.(string))
+	}
+	return true
+}
+
+func (w *WebhookServer) dispatch(body []byte) error {
+	event := jsoniter.Get(body, "event").ToString()
+
+	switch event {
+	case "message_end":
+		var data ChatStreamMessageEndData
+		if err := json.Unmarshal(body, &data); err != nil {
+			return err
+		}
+		w.handler.OnMessageEnd(&data)
+	case "workflow_finished":
+		var data ChatStreamWorkflowFinishedData
+		if err := json.Unmarshal(body, &data); err != nil {
+			return err
+		}
+		w.handler.OnWorkflowFinished(&data)
+	case "node_finished":
+		var data ChatStreamNodeFinishedData
+		if err := json.Unmarshal(body, &data); err != nil {
+			return err
+		}
+		w.handler.OnNodeFinished(&data)
+	case "error":
+		var data ChatStreamErrorData
+		if err := json.Unmarshal(body, &data); err != nil {
+			return err
+		}
+		w.handler.OnError(&data)
+	default:
+		// Dify may add event types, or send ones EventHandler doesn't cover
+		// (e.g. "message"), over time. Ack rather than reject so the sender
+		// doesn't read an unhandled type as a delivery failure and retry it.
+	}
+	return nil
+}
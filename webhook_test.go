@@ -0,0 +1,151 @@
+package dify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingHandler struct {
+	NoopEventHandler
+	messageEnds []*ChatStreamMessageEndData
+}
+
+func (h *recordingHandler) OnMessageEnd(d *ChatStreamMessageEndData) {
+	h.messageEnds = append(h.messageEnds, d)
+}
+
+func signedRequest(t *testing.T, secret, body, id string, ts time.Time) *http.Request {
+	t.Helper()
+	tsStr := strconv.FormatInt(ts.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(tsStr))
+	mac.Write([]byte("."))
+	mac.Write([]byte(body))
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dify", nil)
+	req.Body = io.NopCloser(strings.NewReader(body))
+	req.Header.Set(webhookSignatureHeader, sig)
+	req.Header.Set(webhookTimestampHeader, tsStr)
+	req.Header.Set(webhookEventIDHeader, id)
+	return req
+}
+
+func TestWebhookServerServeHTTP(t *testing.T) {
+	const secret = "test-secret"
+	body := `{"event":"message_end","message_id":"msg-1","conversation_id":"conv-1"}`
+
+	t.Run("valid signature dispatches and acks", func(t *testing.T) {
+		handler := &recordingHandler{}
+		srv := NewWebhookServer(secret, handler)
+
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, signedRequest(t, secret, body, "evt-1", time.Now()))
+
+		if rw.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", rw.Code, http.StatusAccepted)
+		}
+		if len(handler.messageEnds) != 1 || handler.messageEnds[0].MessageID != "msg-1" {
+			t.Fatalf("handler.messageEnds = %+v", handler.messageEnds)
+		}
+	})
+
+	t.Run("bad signature rejected", func(t *testing.T) {
+		srv := NewWebhookServer(secret, &recordingHandler{})
+
+		req := signedRequest(t, secret, body, "evt-2", time.Now())
+		req.Header.Set(webhookSignatureHeader, "0000000000000000000000000000000000000000000000000000000000000000")
+
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rw.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("signature over wrong secret rejected", func(t *testing.T) {
+		srv := NewWebhookServer(secret, &recordingHandler{})
+
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, signedRequest(t, "wrong-secret", body, "evt-3", time.Now()))
+
+		if rw.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rw.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("missing replay headers rejected", func(t *testing.T) {
+		srv := NewWebhookServer(secret, &recordingHandler{})
+
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dify", nil)
+		req.Body = io.NopCloser(strings.NewReader(body))
+
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rw.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("stale timestamp rejected", func(t *testing.T) {
+		srv := NewWebhookServer(secret, &recordingHandler{})
+
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, signedRequest(t, secret, body, "evt-4", time.Now().Add(-time.Hour)))
+
+		if rw.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rw.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("replayed event id rejected", func(t *testing.T) {
+		srv := NewWebhookServer(secret, &recordingHandler{})
+
+		first := httptest.NewRecorder()
+		srv.ServeHTTP(first, signedRequest(t, secret, body, "evt-5", time.Now()))
+		if first.Code != http.StatusAccepted {
+			t.Fatalf("first delivery status = %d, want %d", first.Code, http.StatusAccepted)
+		}
+
+		second := httptest.NewRecorder()
+		srv.ServeHTTP(second, signedRequest(t, secret, body, "evt-5", time.Now()))
+		if second.Code != http.StatusConflict {
+			t.Fatalf("replayed delivery status = %d, want %d", second.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("unknown event type is acked not rejected", func(t *testing.T) {
+		srv := NewWebhookServer(secret, &recordingHandler{})
+		unknownBody := `{"event":"message"}`
+
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, signedRequest(t, secret, unknownBody, "evt-6", time.Now()))
+
+		if rw.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", rw.Code, http.StatusAccepted)
+		}
+	})
+
+	t.Run("non-POST rejected", func(t *testing.T) {
+		srv := NewWebhookServer(secret, &recordingHandler{})
+
+		req := httptest.NewRequest(http.MethodGet, "/webhooks/dify", nil)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("status = %d, want %d", rw.Code, http.StatusMethodNotAllowed)
+		}
+	})
+}